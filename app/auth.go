@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"feed-reader/userstore"
+)
+
+type contextKey string
+
+const userIDContextKey contextKey = "userID"
+
+// userIDParamKey is where apiHandler stashes the authenticated user's ID in
+// the params map passed to every APIHandler, alongside the usual URL params
+const userIDParamKey = "_userID"
+
+// authMiddleware authenticates the request via HTTP Basic auth or an API
+// token (Authorization: Token <token>), and stashes the resulting user ID on
+// the request context for apiHandler to pick up.
+//
+// It deliberately doesn't reject unauthenticated requests itself - routes
+// like creating an account have to stay open to anonymous callers. Handlers
+// that require a user check params[userIDParamKey] and return an
+// UnauthorizedError if it's missing.
+func authMiddleware(userStore userstore.UserStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if username, password, ok := r.BasicAuth(); ok {
+				user, err := userStore.Authenticate(username, password)
+				if err == nil {
+					next.ServeHTTP(w, r.WithContext(withUserID(r.Context(), user.ID)))
+					return
+				}
+			} else if token := bearerToken(r); token != "" {
+				user, err := userStore.GetByToken(token)
+				if err == nil {
+					next.ServeHTTP(w, r.WithContext(withUserID(r.Context(), user.ID)))
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	const prefix = "Token "
+	header := r.Header.Get("Authorization")
+	if len(header) > len(prefix) && header[:len(prefix)] == prefix {
+		return header[len(prefix):]
+	}
+	return ""
+}
+
+func withUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDContextKey, userID)
+}
+
+func userIDFromContext(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(userIDContextKey).(string)
+	return userID, ok
+}
+
+// requireUserID pulls the authenticated user ID out of a handler's params,
+// returning an UnauthorizedError if the request wasn't authenticated
+func requireUserID(params map[string]string) (string, error) {
+	userID, ok := params[userIDParamKey]
+	if !ok || userID == "" {
+		return "", UnauthorizedError{err: errors.New("authentication required")}
+	}
+	return userID, nil
+}
@@ -0,0 +1,53 @@
+package app
+
+import "net/http"
+
+// HttpError is implemented by errors that know which HTTP status code they
+// should be reported to the client with
+type HttpError interface {
+	error
+	StatusCode() int
+}
+
+// NotFoundError is returned when the requested resource doesn't exist
+type NotFoundError struct {
+	err error
+}
+
+func (e NotFoundError) Error() string {
+	return e.err.Error()
+}
+
+// StatusCode satisfies the HttpError interface
+func (e NotFoundError) StatusCode() int {
+	return http.StatusNotFound
+}
+
+// BadRequestError is returned when the request body or params are invalid
+type BadRequestError struct {
+	err error
+}
+
+func (e BadRequestError) Error() string {
+	return e.err.Error()
+}
+
+// StatusCode satisfies the HttpError interface
+func (e BadRequestError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// UnauthorizedError is returned when a route requires an authenticated user
+// and the request didn't carry valid credentials
+type UnauthorizedError struct {
+	err error
+}
+
+func (e UnauthorizedError) Error() string {
+	return e.err.Error()
+}
+
+// StatusCode satisfies the HttpError interface
+func (e UnauthorizedError) StatusCode() int {
+	return http.StatusUnauthorized
+}
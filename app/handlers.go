@@ -0,0 +1,360 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"feed-reader/feedlist"
+	"feed-reader/feedlist/discovery"
+	"feed-reader/fetcher"
+	"feed-reader/scheduler"
+	"feed-reader/userstore"
+)
+
+// GETFeedListHandler returns every feed stored for the authenticated user,
+// ordered by sortByErrors when called with ?sort=errors
+type GETFeedListHandler struct {
+	store feedlist.FeedListStore
+}
+
+func (handler GETFeedListHandler) Handle(body []byte, params map[string]string, query map[string]string) (interface{}, error) {
+	userID, err := requireUserID(params)
+	if err != nil {
+		return nil, err
+	}
+
+	feeds, err := handler.store.ListAll(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if query["sort"] == "errors" {
+		sortByErrors(feeds)
+	}
+
+	return feeds, nil
+}
+
+// sortByErrors orders feeds the way Miniflux's storage layer does when
+// surfacing unhealthy feeds first: disabled feeds last, then by descending
+// error count, then by descending unread count, then alphabetically
+func sortByErrors(feeds []feedlist.Feed) {
+	sort.Slice(feeds, func(i, j int) bool {
+		a, b := feeds[i], feeds[j]
+		if a.Disabled != b.Disabled {
+			return !a.Disabled
+		}
+		if a.ParsingErrorCount != b.ParsingErrorCount {
+			return a.ParsingErrorCount > b.ParsingErrorCount
+		}
+		if a.UnreadCount != b.UnreadCount {
+			return a.UnreadCount > b.UnreadCount
+		}
+		return a.Title < b.Title
+	})
+}
+
+// GETFeedHandler returns a single stored feed by ID
+type GETFeedHandler struct {
+	store   feedlist.FeedListStore
+	fetcher fetcher.Fetcher
+}
+
+func (handler GETFeedHandler) Handle(body []byte, params map[string]string, query map[string]string) (interface{}, error) {
+	userID, err := requireUserID(params)
+	if err != nil {
+		return nil, err
+	}
+
+	id, ok := params["id"]
+	if !ok {
+		return nil, BadRequestError{err: errors.New("id is required")}
+	}
+
+	feed, err := handler.store.GetByID(id, userID)
+	if err != nil {
+		if err == feedlist.ErrorFeedNotFound {
+			return nil, NotFoundError{err: err}
+		}
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+type postFeedRequest struct {
+	URL        string `json:"url"`
+	CategoryID string `json:"category_id"`
+}
+
+// POSTFeedHandler validates and adds a new feed to the store
+type POSTFeedHandler struct {
+	store   feedlist.FeedListStore
+	fetcher fetcher.Fetcher
+}
+
+func (handler POSTFeedHandler) Handle(body []byte, params map[string]string, query map[string]string) (interface{}, error) {
+	userID, err := requireUserID(params)
+	if err != nil {
+		return nil, err
+	}
+
+	req := postFeedRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, BadRequestError{err: err}
+	}
+	if req.URL == "" {
+		return nil, BadRequestError{err: errors.New("url is required")}
+	}
+	if req.CategoryID == "" {
+		return nil, BadRequestError{err: errors.New("category_id is required")}
+	}
+
+	exists, err := handler.store.CategoryExists(req.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, BadRequestError{err: errors.New("category_id does not exist")}
+	}
+
+	id, err := handler.store.Add(feedlist.Feed{URL: req.URL, CategoryID: req.CategoryID}, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler.store.GetByID(id, userID)
+}
+
+// POSTFeedRefreshHandler forces an immediate refresh of a single feed,
+// outside of the scheduler's normal polling interval
+type POSTFeedRefreshHandler struct {
+	store     feedlist.FeedListStore
+	scheduler scheduler.Scheduler
+}
+
+func (handler POSTFeedRefreshHandler) Handle(body []byte, params map[string]string, query map[string]string) (interface{}, error) {
+	userID, err := requireUserID(params)
+	if err != nil {
+		return nil, err
+	}
+
+	id, ok := params["id"]
+	if !ok {
+		return nil, BadRequestError{err: errors.New("id is required")}
+	}
+
+	feed, err := handler.store.GetByID(id, userID)
+	if err != nil {
+		if err == feedlist.ErrorFeedNotFound {
+			return nil, NotFoundError{err: err}
+		}
+		return nil, err
+	}
+
+	if err := handler.scheduler.RefreshFeed(feed, userID); err != nil {
+		return nil, err
+	}
+
+	return handler.store.GetByID(id, userID)
+}
+
+// GETCategoryListHandler returns every stored Category
+type GETCategoryListHandler struct {
+	store feedlist.FeedListStore
+}
+
+func (handler GETCategoryListHandler) Handle(body []byte, params map[string]string, query map[string]string) (interface{}, error) {
+	if _, err := requireUserID(params); err != nil {
+		return nil, err
+	}
+
+	return handler.store.ListCategories()
+}
+
+type postCategoryRequest struct {
+	Title string `json:"title"`
+}
+
+// POSTCategoryHandler creates a new Category
+type POSTCategoryHandler struct {
+	store feedlist.FeedListStore
+}
+
+func (handler POSTCategoryHandler) Handle(body []byte, params map[string]string, query map[string]string) (interface{}, error) {
+	if _, err := requireUserID(params); err != nil {
+		return nil, err
+	}
+
+	req := postCategoryRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, BadRequestError{err: err}
+	}
+	if req.Title == "" {
+		return nil, BadRequestError{err: errors.New("title is required")}
+	}
+
+	id, err := handler.store.CreateCategory(feedlist.Category{Title: req.Title})
+	if err != nil {
+		return nil, err
+	}
+
+	return feedlist.Category{ID: id, Title: req.Title}, nil
+}
+
+// DELETECategoryHandler removes a Category by ID
+type DELETECategoryHandler struct {
+	store feedlist.FeedListStore
+}
+
+func (handler DELETECategoryHandler) Handle(body []byte, params map[string]string, query map[string]string) (interface{}, error) {
+	if _, err := requireUserID(params); err != nil {
+		return nil, err
+	}
+
+	id, ok := params["id"]
+	if !ok {
+		return nil, BadRequestError{err: errors.New("id is required")}
+	}
+
+	if err := handler.store.DeleteCategory(id); err != nil {
+		return nil, err
+	}
+
+	return map[string]bool{"ok": true}, nil
+}
+
+// GETCategoryFeedsHandler lists every Feed belonging to a Category
+type GETCategoryFeedsHandler struct {
+	store feedlist.FeedListStore
+}
+
+func (handler GETCategoryFeedsHandler) Handle(body []byte, params map[string]string, query map[string]string) (interface{}, error) {
+	userID, err := requireUserID(params)
+	if err != nil {
+		return nil, err
+	}
+
+	id, ok := params["id"]
+	if !ok {
+		return nil, BadRequestError{err: errors.New("id is required")}
+	}
+
+	return handler.store.ListFeedsByCategoryID(id, userID)
+}
+
+type postUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type userResponse struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	APIToken string `json:"api_token"`
+}
+
+// POSTUserHandler registers a new account. Deliberately left open to
+// unauthenticated callers, otherwise nobody could ever create the first
+// user. The very first account created gets the demo feed list seeded into
+// it, mirroring what the old shared defaultFeedsList used to give everyone.
+type POSTUserHandler struct {
+	store         userstore.UserStore
+	feedListStore feedlist.FeedListStore
+}
+
+func (handler POSTUserHandler) Handle(body []byte, params map[string]string, query map[string]string) (interface{}, error) {
+	req := postUserRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, BadRequestError{err: err}
+	}
+	if req.Username == "" || req.Password == "" {
+		return nil, BadRequestError{err: errors.New("username and password are required")}
+	}
+
+	isFirstUser, err := handler.store.Count()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := handler.store.Create(req.Username, req.Password)
+	if err != nil {
+		if err == userstore.ErrorUsernameTaken {
+			return nil, BadRequestError{err: err}
+		}
+		return nil, err
+	}
+
+	if isFirstUser == 0 {
+		if err := handler.feedListStore.SeedDefaultFeeds(user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return userResponse{ID: user.ID, Username: user.Username, APIToken: user.APIToken}, nil
+}
+
+type postTokenRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// POSTTokenHandler exchanges a username/password for the user's API token,
+// so clients that can't send Basic auth on every request can use a bearer
+// token instead
+type POSTTokenHandler struct {
+	store userstore.UserStore
+}
+
+func (handler POSTTokenHandler) Handle(body []byte, params map[string]string, query map[string]string) (interface{}, error) {
+	req := postTokenRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, BadRequestError{err: err}
+	}
+	if req.Username == "" || req.Password == "" {
+		return nil, BadRequestError{err: errors.New("username and password are required")}
+	}
+
+	user, err := handler.store.Authenticate(req.Username, req.Password)
+	if err != nil {
+		if err == userstore.ErrorInvalidCredentials {
+			return nil, UnauthorizedError{err: err}
+		}
+		return nil, err
+	}
+
+	return map[string]string{"token": user.APIToken}, nil
+}
+
+type postDiscoverRequest struct {
+	URL string `json:"url"`
+}
+
+// POSTDiscoverHandler looks at a web page and returns the feeds it
+// publishes, so a subscription can be added from a site's URL instead of
+// requiring the user to already know the direct feed URL
+type POSTDiscoverHandler struct {
+	discoverer discovery.Discoverer
+}
+
+func (handler POSTDiscoverHandler) Handle(body []byte, params map[string]string, query map[string]string) (interface{}, error) {
+	if _, err := requireUserID(params); err != nil {
+		return nil, err
+	}
+
+	req := postDiscoverRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, BadRequestError{err: err}
+	}
+	if req.URL == "" {
+		return nil, BadRequestError{err: errors.New("url is required")}
+	}
+
+	candidates, err := handler.discoverer.Discover(req.URL)
+	if err != nil {
+		return nil, BadRequestError{err: err}
+	}
+
+	return candidates, nil
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"feed-reader/feedlist"
+	"feed-reader/feedlist/opml"
+)
+
+// GETExportHandler returns every one of the authenticated user's feeds as an
+// OPML 2.0 document, grouped by category. It's registered directly with
+// muxie rather than going through apiHandler, since its response is XML
+// rather than the usual JSON envelope.
+func GETExportHandler(store feedlist.FeedListStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := userIDFromContext(r.Context())
+		if !ok {
+			writeOPMLError(w, http.StatusUnauthorized, errors.New("authentication required"))
+			return
+		}
+
+		feeds, err := store.ListAll(userID)
+		if err != nil {
+			writeOPMLError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		categories, err := store.ListCategories()
+		if err != nil {
+			writeOPMLError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/xml;charset=utf8")
+		w.Header().Set("Content-Disposition", `attachment; filename="subscriptions.opml"`)
+		w.Write(opml.Marshal(feeds, categories))
+	}
+}
+
+// POSTImportHandler reads an OPML document, either a multipart file upload
+// or a raw application/xml body, and adds every feed it finds to the
+// authenticated user's list, deduplicating by URL the same way Add already
+// does. Feeds are re-grouped into categories matching the outline titles
+// they were nested under, finding or creating each by title as needed.
+func POSTImportHandler(store feedlist.FeedListStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := userIDFromContext(r.Context())
+		if !ok {
+			writeOPMLError(w, http.StatusUnauthorized, errors.New("authentication required"))
+			return
+		}
+
+		body, err := opmlBody(r)
+		if err != nil {
+			writeOPMLError(w, http.StatusBadRequest, err)
+			return
+		}
+		defer body.Close()
+
+		feeds, err := opml.Parse(body)
+		if err != nil {
+			writeOPMLError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		imported := 0
+		categoryIDsByTitle := map[string]string{}
+		for _, importedFeed := range feeds {
+			categoryID, ok := categoryIDsByTitle[importedFeed.CategoryTitle]
+			if !ok {
+				var err error
+				categoryID, err = store.FindOrCreateCategoryByTitle(importedFeed.CategoryTitle)
+				if err != nil {
+					writeOPMLError(w, http.StatusInternalServerError, err)
+					return
+				}
+				categoryIDsByTitle[importedFeed.CategoryTitle] = categoryID
+			}
+
+			feed := importedFeed.Feed
+			feed.CategoryID = categoryID
+			if _, err := store.Add(feed, userID); err != nil {
+				writeOPMLError(w, http.StatusInternalServerError, err)
+				return
+			}
+			imported++
+		}
+
+		w.Header().Set("Content-Type", "application/json;charset=utf8")
+		rsp, err := json.Marshal(map[string]int{"imported": imported})
+		if err != nil {
+			writeOPMLError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Write(rsp)
+	}
+}
+
+func opmlBody(r *http.Request) (io.ReadCloser, error) {
+	t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	if t == "multipart/form-data" {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		return file, nil
+	}
+
+	return r.Body, nil
+}
+
+func writeOPMLError(w http.ResponseWriter, statusCode int, err error) {
+	w.Header().Set("Content-Type", "application/json;charset=utf8")
+	w.WriteHeader(statusCode)
+	fmt.Fprintf(w, jsonError(err))
+}
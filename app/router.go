@@ -4,7 +4,10 @@ import (
 	"github.com/kataras/muxie"
 
 	"feed-reader/feedlist"
+	"feed-reader/feedlist/discovery"
 	"feed-reader/fetcher"
+	"feed-reader/scheduler"
+	"feed-reader/userstore"
 
 	"encoding/json"
 	"errors"
@@ -15,27 +18,62 @@ import (
 	"strings"
 )
 
-func InitRouter(feedListStore feedlist.FeedListStore, feedFetcher fetcher.Fetcher) *muxie.Mux {
+func InitRouter(feedListStore feedlist.FeedListStore, userStore userstore.UserStore, feedFetcher fetcher.Fetcher) *muxie.Mux {
 	mux := muxie.NewMux()
 	//mux.PathCorrection = true
 
+	refreshScheduler := scheduler.New(feedListStore, userStore, feedFetcher)
+	go refreshScheduler.Run()
+
 	api := mux.Of("/api")
-	api.Use(apiMiddleware)
+	api.Use(apiMiddleware, authMiddleware(userStore))
 	api.HandleFunc("/*path", apiHandler(NotFoundHandler{}))
+	api.Handle("/users", muxie.Methods().
+		HandleFunc(http.MethodPost, apiHandler(POSTUserHandler{store: userStore, feedListStore: feedListStore})))
+	api.Handle("/tokens", muxie.Methods().
+		HandleFunc(http.MethodPost, apiHandler(POSTTokenHandler{store: userStore})))
 	api.Handle("/feeds/:id", muxie.Methods().
 		HandleFunc(http.MethodGet, apiHandler(GETFeedHandler{store: feedListStore, fetcher: feedFetcher})))
+	api.Handle("/feeds/:id/refresh", muxie.Methods().
+		HandleFunc(http.MethodPost, apiHandler(POSTFeedRefreshHandler{store: feedListStore, scheduler: refreshScheduler})))
 	api.Handle("/feeds", muxie.Methods().
 		HandleFunc(http.MethodGet, apiHandler(GETFeedListHandler{store: feedListStore})).
 		HandleFunc(http.MethodPost, apiHandler(POSTFeedHandler{store: feedListStore, fetcher: feedFetcher})))
+	api.Handle("/categories", muxie.Methods().
+		HandleFunc(http.MethodGet, apiHandler(GETCategoryListHandler{store: feedListStore})).
+		HandleFunc(http.MethodPost, apiHandler(POSTCategoryHandler{store: feedListStore})))
+	api.Handle("/categories/:id", muxie.Methods().
+		HandleFunc(http.MethodDelete, apiHandler(DELETECategoryHandler{store: feedListStore})))
+	api.Handle("/categories/:id/feeds", muxie.Methods().
+		HandleFunc(http.MethodGet, apiHandler(GETCategoryFeedsHandler{store: feedListStore})))
+	api.Handle("/discover", muxie.Methods().
+		HandleFunc(http.MethodPost, apiHandler(POSTDiscoverHandler{discoverer: discovery.NewDiscoverer()})))
+	api.Handle("/export", muxie.Methods().
+		HandleFunc(http.MethodGet, GETExportHandler(feedListStore)))
+	api.Handle("/import", muxie.Methods().
+		HandleFunc(http.MethodPost, POSTImportHandler(feedListStore)))
 
 	return mux
 }
 
+// opmlRoutes are allowed to send/receive XML (and, for import, a multipart
+// file upload) on top of the usual JSON - they're the only routes whose
+// payload isn't JSON in either direction
+var opmlRoutes = map[string]bool{
+	"/api/export": true,
+	"/api/import": true,
+}
+
 func apiMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		contentType := r.Header.Get("Content-Type")
 		w.Header().Set("Content-Type", "application/json;charset=utf8")
 
+		allowedTypes := []string{"application/json"}
+		if opmlRoutes[r.URL.Path] {
+			allowedTypes = append(allowedTypes, "text/xml", "application/xml", "multipart/form-data")
+		}
+
 		for _, v := range strings.Split(contentType, ",") {
 			t, _, err := mime.ParseMediaType(v)
 			if err != nil {
@@ -43,9 +81,11 @@ func apiMiddleware(next http.Handler) http.Handler {
 				w.Write([]byte(fmt.Sprintf(`{"error": "Media type (%s) not parseable"}`, v)))
 				return
 			}
-			if t == "application/json" {
-				next.ServeHTTP(w, r)
-				return
+			for _, allowed := range allowedTypes {
+				if t == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
 			}
 		}
 		w.WriteHeader(http.StatusUnsupportedMediaType)
@@ -54,7 +94,7 @@ func apiMiddleware(next http.Handler) http.Handler {
 }
 
 type APIHandler interface {
-	Handle(body []byte, params map[string]string) (interface{}, error)
+	Handle(body []byte, params map[string]string, query map[string]string) (interface{}, error)
 }
 
 func apiHandler(handler APIHandler) func(http.ResponseWriter, *http.Request) {
@@ -64,11 +104,27 @@ func apiHandler(handler APIHandler) func(http.ResponseWriter, *http.Request) {
 			fmt.Fprintf(w, jsonError(err))
 		}
 		defer r.Body.Close()
+
+		// params carries route params (e.g. :id) and the authenticated
+		// user's ID - it must never be populated from the query string, or
+		// a caller could pass ?_userID=<victim> to impersonate anyone, or
+		// ?id=<other> to override a route param
 		params := map[string]string{}
 		for _, keyPair := range muxie.GetParams(w) {
 			params[keyPair.Key] = keyPair.Value
 		}
-		rsp, err := handler.Handle(b, params)
+		if userID, ok := userIDFromContext(r.Context()); ok {
+			params[userIDParamKey] = userID
+		}
+
+		query := map[string]string{}
+		for key, values := range r.URL.Query() {
+			if len(values) > 0 {
+				query[key] = values[0]
+			}
+		}
+
+		rsp, err := handler.Handle(b, params, query)
 		if err != nil {
 			// If we specifically return an HttpError we can use its code,
 			// otherwise we just default to Internal Server Error
@@ -95,7 +151,7 @@ func apiHandler(handler APIHandler) func(http.ResponseWriter, *http.Request) {
 type NotFoundHandler struct {
 }
 
-func (handler NotFoundHandler) Handle(body []byte, params map[string]string) (interface{}, error) {
+func (handler NotFoundHandler) Handle(body []byte, params map[string]string, query map[string]string) (interface{}, error) {
 	return nil, NotFoundError{err: errors.New("Endpoint not found")}
 }
 
@@ -0,0 +1,310 @@
+package feedlist
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/boltdb/bolt"
+	"github.com/google/uuid"
+)
+
+const (
+	categoryBucket        = "categories"
+	allCategoriesKey      = "all"
+	seededSkyNewsCategory = "d290f1ee-6c54-4b01-90e6-d701748f0851"
+)
+
+var (
+	// ErrorCategoryNotFound occurs when looking up a CategoryID that isn't
+	// stored
+	ErrorCategoryNotFound = errors.New("Category does not exist")
+)
+
+// Category groups feeds together, mirroring the way Miniflux lets a user
+// organise their subscriptions
+type Category struct {
+	ID         string
+	Title      string
+	UserHidden bool
+}
+
+// CreateCategory stores a new Category and returns its ID
+func (store FeedListStore) CreateCategory(category Category) (string, error) {
+	category.ID = uuid.NewString()
+	categories, err := store.listCategories()
+	if err != nil {
+		return "", err
+	}
+
+	rawCategories, err := json.Marshal(append(categories, category))
+	if err != nil {
+		log.Printf("Error: Failed to marshal category %v", category)
+		return "", err
+	}
+
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(categoryBucket))
+		if bucket == nil {
+			log.Printf("Error: Unconfigured bucket")
+			return ErrorUnconfiguredBucket
+		}
+		return bucket.Put([]byte(allCategoriesKey), rawCategories)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return category.ID, nil
+}
+
+// ListCategories returns every stored Category
+func (store FeedListStore) ListCategories() ([]Category, error) {
+	return store.listCategories()
+}
+
+// DeleteCategory removes a Category by ID
+func (store FeedListStore) DeleteCategory(ID string) error {
+	categories, err := store.listCategories()
+	if err != nil {
+		return err
+	}
+
+	kept := categories[:0]
+	for _, category := range categories {
+		if category.ID != ID {
+			kept = append(kept, category)
+		}
+	}
+
+	rawCategories, err := json.Marshal(kept)
+	if err != nil {
+		log.Printf("Error: Failed to marshal categories %v", kept)
+		return err
+	}
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(categoryBucket))
+		if bucket == nil {
+			log.Printf("Error: Unconfigured bucket")
+			return ErrorUnconfiguredBucket
+		}
+		return bucket.Put([]byte(allCategoriesKey), rawCategories)
+	})
+}
+
+// ListFeedsByCategoryID returns every Feed belonging to the given CategoryID,
+// scoped to the given user
+func (store FeedListStore) ListFeedsByCategoryID(categoryID string, userID string) ([]Feed, error) {
+	feeds, err := store.ListAll(userID)
+	if err != nil {
+		return []Feed{}, err
+	}
+
+	filtered := []Feed{}
+	for _, feed := range feeds {
+		if feed.CategoryID == categoryID {
+			filtered = append(filtered, feed)
+		}
+	}
+
+	return filtered, nil
+}
+
+// FindOrCreateCategoryByTitle returns the ID of the Category with the given
+// Title, creating one if no such Category exists yet. It's used by OPML
+// import to recreate a subscription list's category structure from its
+// outline titles, which have no CategoryID of their own to carry over.
+func (store FeedListStore) FindOrCreateCategoryByTitle(title string) (string, error) {
+	categories, err := store.listCategories()
+	if err != nil {
+		return "", err
+	}
+
+	for _, category := range categories {
+		if category.Title == title {
+			return category.ID, nil
+		}
+	}
+
+	return store.CreateCategory(Category{Title: title})
+}
+
+// CategoryExists reports whether a CategoryID is known to the store
+func (store FeedListStore) CategoryExists(categoryID string) (bool, error) {
+	categories, err := store.listCategories()
+	if err != nil {
+		return false, err
+	}
+
+	for _, category := range categories {
+		if category.ID == categoryID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (store FeedListStore) listCategories() ([]Category, error) {
+	rawCategories := []byte{}
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(categoryBucket))
+		if bucket == nil {
+			log.Printf("Error: Bucket `" + categoryBucket + "` is unconfigured")
+			return ErrorUnconfiguredBucket
+		}
+		rawCategories = bucket.Get([]byte(allCategoriesKey))
+		return nil
+	})
+	if err != nil {
+		return []Category{}, err
+	}
+
+	if len(rawCategories) == 0 {
+		return []Category{}, nil
+	}
+
+	categories := []Category{}
+	if err := json.Unmarshal(rawCategories, &categories); err != nil {
+		log.Printf("Error: can't unmarshal categories %v", rawCategories)
+		return []Category{}, ErrorStoreFeedListCorrupted
+	}
+
+	return categories, nil
+}
+
+// legacyFeed mirrors the pre-categories shape of a stored Feed - just enough
+// to recover the old free-form Category string, which no longer has a field
+// on Feed to unmarshal into
+type legacyFeed struct {
+	ID       string
+	Category string
+}
+
+// initCategories creates the categories bucket, seeds it with the category
+// the old free-form "Sky News" string used to represent, and migrates any
+// already-persisted Feed rows still carrying that string onto the seeded
+// category's ID
+func (store FeedListStore) initCategories() error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(categoryBucket))
+		if err != nil {
+			log.Printf("Error creating bucket: %s", err)
+			return ErrorInitializingDB
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	categories, err := store.listCategories()
+	if err != nil {
+		return err
+	}
+
+	for _, category := range categories {
+		if category.ID == seededSkyNewsCategory {
+			return nil
+		}
+	}
+
+	rawCategories, err := json.Marshal(append(categories, Category{
+		ID:    seededSkyNewsCategory,
+		Title: "Sky News",
+	}))
+	if err != nil {
+		return err
+	}
+
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(categoryBucket))
+		if bucket == nil {
+			return ErrorUnconfiguredBucket
+		}
+		return bucket.Put([]byte(allCategoriesKey), rawCategories)
+	})
+	if err != nil {
+		return err
+	}
+
+	return store.migrateLegacyCategoryField()
+}
+
+// migrateLegacyCategoryField rewrites any stored Feed rows - across every
+// user's bucket key - that still carry the old free-form "Sky News" Category
+// string onto the CategoryID of the category seeded for them above. Without
+// this, rows persisted before the categories subsystem existed would silently
+// lose their category on upgrade, since the old Category field no longer
+// exists on Feed for json.Unmarshal to populate. Any other Category string
+// has no seeded category to map onto and is dropped when its list is
+// rewritten.
+func (store FeedListStore) migrateLegacyCategoryField() error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(feedListBucket))
+		if bucket == nil {
+			return ErrorUnconfiguredBucket
+		}
+
+		// Collect the rewritten rows first rather than calling bucket.Put
+		// from inside ForEach - bolt's docs warn that modifying a bucket
+		// during ForEach is undefined behaviour.
+		migratedRows := map[string][]byte{}
+
+		err := bucket.ForEach(func(key, rawFeedList []byte) error {
+			if len(rawFeedList) == 0 {
+				return nil
+			}
+
+			legacyFeeds := []legacyFeed{}
+			if err := json.Unmarshal(rawFeedList, &legacyFeeds); err != nil {
+				log.Printf("Error: can't unmarshal feed %v during category migration", rawFeedList)
+				return ErrorStoreFeedListCorrupted
+			}
+
+			migrated := false
+			for _, legacy := range legacyFeeds {
+				if legacy.Category != "" {
+					migrated = true
+					break
+				}
+			}
+			if !migrated {
+				return nil
+			}
+
+			feeds := []Feed{}
+			if err := json.Unmarshal(rawFeedList, &feeds); err != nil {
+				log.Printf("Error: can't unmarshal feed %v during category migration", rawFeedList)
+				return ErrorStoreFeedListCorrupted
+			}
+
+			for i := range feeds {
+				if legacyFeeds[i].Category == "Sky News" {
+					feeds[i].CategoryID = seededSkyNewsCategory
+				}
+			}
+
+			rawFeeds, err := json.Marshal(feeds)
+			if err != nil {
+				log.Printf("Error: Failed to marshal feeds %v during category migration", feeds)
+				return err
+			}
+
+			migratedRows[string(key)] = rawFeeds
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for key, rawFeeds := range migratedRows {
+			if err := bucket.Put([]byte(key), rawFeeds); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
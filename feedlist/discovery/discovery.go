@@ -0,0 +1,203 @@
+package discovery
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// maxResponseBytes caps how much of a candidate page we'll read, so a
+// malicious or misbehaving server can't have us buffer an unbounded response
+const maxResponseBytes = 5 * 1024 * 1024
+
+var feedLinkTypes = map[string]string{
+	"application/rss+xml":  "rss",
+	"application/atom+xml": "atom",
+}
+
+// fallbackPaths are tried, in order, when a page has no <link rel="alternate">
+// feed tags of its own
+var fallbackPaths = []string{"/feed", "/rss", "/atom.xml"}
+
+// Candidate is a feed found while discovering subscriptions for a page
+type Candidate struct {
+	Title string `json:"title"`
+	Type  string `json:"type"`
+	URL   string `json:"url"`
+}
+
+// Discoverer looks at a web page and works out what feeds it publishes, so a
+// user can subscribe by pasting a site's URL rather than hunting down its
+// actual feed URL
+type Discoverer struct {
+	client *http.Client
+}
+
+// NewDiscoverer returns a fully initialised Discoverer
+func NewDiscoverer() Discoverer {
+	return Discoverer{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 2 {
+					return http.ErrUseLastResponse
+				}
+				return rejectUnsafeHost(req.URL)
+			},
+		},
+	}
+}
+
+// Discover fetches pageURL and returns every feed it can find, preferring
+// <link rel="alternate"> tags and falling back to a handful of conventional
+// feed paths (/feed, /rss, /atom.xml) if none are present
+func (d Discoverer) Discover(pageURL string) ([]Candidate, error) {
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := rejectUnsafeHost(parsed); err != nil {
+		return nil, err
+	}
+
+	resp, err := d.client.Get(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Re-derive base from the response's final URL rather than the
+	// caller-supplied one: a 301/302 (http->https, bare domain->www, the
+	// common case) means relative hrefs and the fallback paths below have to
+	// resolve against wherever we actually ended up, not where we started
+	base := resp.Request.URL
+
+	candidates, err := d.parseLinks(io.LimitReader(resp.Body, maxResponseBytes), base)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candidates) > 0 {
+		return candidates, nil
+	}
+
+	return d.fallbackCandidates(base), nil
+}
+
+// rejectUnsafeHost refuses to let the discoverer be used as a generic
+// SSRF primitive: it resolves the URL's host and rejects anything that
+// lands on a loopback, link-local, private-range, or unspecified address
+// (e.g. 127.0.0.1, 169.254.169.254 cloud metadata, 10.0.0.0/8, ::1)
+func rejectUnsafeHost(u *url.URL) error {
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("missing host in URL %q", u.String())
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if isDisallowedIP(ip) {
+			return fmt.Errorf("refusing to fetch %q: disallowed address", u.String())
+		}
+		return nil
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return fmt.Errorf("could not resolve host %q: %w", host, err)
+	}
+	for _, ip := range ips {
+		if isDisallowedIP(ip) {
+			return fmt.Errorf("refusing to fetch %q: resolves to a disallowed address", u.String())
+		}
+	}
+
+	return nil
+}
+
+func isDisallowedIP(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified()
+}
+
+func (d Discoverer) parseLinks(body io.Reader, base *url.URL) ([]Candidate, error) {
+	doc, err := html.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []Candidate{}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "link" {
+			if candidate, ok := linkCandidate(n, base); ok {
+				candidates = append(candidates, candidate)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return candidates, nil
+}
+
+func linkCandidate(n *html.Node, base *url.URL) (Candidate, bool) {
+	attrs := map[string]string{}
+	for _, a := range n.Attr {
+		attrs[a.Key] = a.Val
+	}
+
+	if attrs["rel"] != "alternate" || attrs["href"] == "" {
+		return Candidate{}, false
+	}
+
+	feedType, ok := feedLinkTypes[attrs["type"]]
+	if !ok {
+		return Candidate{}, false
+	}
+
+	return Candidate{
+		Title: attrs["title"],
+		Type:  feedType,
+		URL:   resolveURL(base, attrs["href"]),
+	}, true
+}
+
+func (d Discoverer) fallbackCandidates(base *url.URL) []Candidate {
+	candidates := []Candidate{}
+	for _, path := range fallbackPaths {
+		candidateURL := resolveURL(base, path)
+		resp, err := d.client.Head(candidateURL)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+		candidates = append(candidates, Candidate{
+			Title: strings.TrimPrefix(path, "/"),
+			Type:  "unknown",
+			URL:   candidateURL,
+		})
+	}
+	return candidates
+}
+
+func resolveURL(base *url.URL, href string) string {
+	ref, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	return base.ResolveReference(ref).String()
+}
@@ -4,20 +4,20 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/google/uuid"
 )
 
-const (
-	feedListBucket    = "feedlist"
-	allFeedsBucketKey = "all"
-)
+const feedListBucket = "feedlist"
 
 var (
-	// Note: I only included this to make the app easier to demo, in the
-	// real version this would just not be here and we'd have to set up
-	// every entry with a call to the POST /feeed handler
+	// defaultFeedsList is seeded once, into the very first user created, by
+	// SeedDefaultFeeds. It used to be merged into every ListAll call so the
+	// app had something to demo, but that doesn't make sense once feeds are
+	// scoped per user - a second user shouldn't see the first user's demo
+	// data, let alone have it merged into their own list.
 	defaultFeedsList = []Feed{
 		Feed{
 			ID:          "b1031651-411c-40bb-b269-d247794dfd59",
@@ -38,7 +38,7 @@ var (
 			Title:       "UK News - The latest headlines from the UK | Sky News",
 			Description: "Expert comment and analysis on the latest UK news, with headlines from England, Scotland, Northern Ireland and Wales.",
 			URL:         "http://feeds.skynews.com/feeds/rss/uk.xml",
-			Category:    "Sky News",
+			CategoryID:  seededSkyNewsCategory,
 			ImageURL:    "http://feeds.skynews.com/images/web/logo/skynews_rss.png",
 		},
 		Feed{
@@ -46,7 +46,7 @@ var (
 			Title:       "Tech News - Latest Technology and Gadget News | Sky News",
 			Description: "Sky News technology provides you with all the latest tech and gadget news, game reviews, Internet and web news across the globe. Visit us today.",
 			URL:         "http://feeds.skynews.com/feeds/rss/technology.xml",
-			Category:    "Sky News",
+			CategoryID:  seededSkyNewsCategory,
 			ImageURL:    "http://feeds.skynews.com/images/web/logo/skynews_rss.png",
 		},
 	}
@@ -65,7 +65,8 @@ var (
 )
 
 // FeedListStore is where we keep the available feeds that can be queried to
-// get articles
+// get articles. Entries are keyed by the owning user's ID, so every method
+// that reads or writes feeds takes a userID.
 type FeedListStore struct {
 	db *bolt.DB
 }
@@ -78,7 +79,30 @@ type Feed struct {
 	Description string
 	URL         string
 	ImageURL    string
-	Category    string
+	// CategoryID refers to a Category stored in the categories bucket. It
+	// used to be a free-form string (e.g. "Sky News"); existing rows are
+	// migrated onto the seeded category of the same name in initCategories.
+	CategoryID string
+	// FeedURL is the effective URL the feed was last fetched from, after
+	// following any redirects. Falls back to URL until the first fetch.
+	FeedURL string
+	// EtagHeader and LastModifiedHeader are the values returned by the last
+	// 200 response, sent back as If-None-Match / If-Modified-Since on the
+	// next refresh so unchanged feeds can be fetched with a cheap 304.
+	EtagHeader         string
+	LastModifiedHeader string
+	// Disabled feeds are skipped by the scheduler entirely
+	Disabled bool
+	// ParsingErrorCount is the number of consecutive failed refreshes. It
+	// resets to zero on a successful fetch and sets the scheduler's backoff,
+	// in hours, until the next attempt.
+	ParsingErrorCount int
+	// UnreadCount is kept up to date by the (not yet implemented) article
+	// store; it only exists here so feeds can be sorted by it.
+	UnreadCount int
+	// LastCheckedAt and NextCheckAt are maintained by the scheduler
+	LastCheckedAt time.Time
+	NextCheckAt   time.Time
 }
 
 // NewFeedListStore returns a fully initialised FeedListStore and should be the
@@ -98,22 +122,12 @@ func NewFeedListStore(db *bolt.DB) (FeedListStore, error) {
 	return store, nil
 }
 
-// ListAll returns a list of all the Feeds that have been stored, including a
-// hardcoded list for demo purposes
-func (store FeedListStore) ListAll() ([]Feed, error) {
-	storedFeedList, err := store.listStored()
-	if err != nil {
-		return []Feed{}, err
-	}
-
-	if storedFeedList == nil {
-		return defaultFeedsList, nil
-	}
-
-	return append(defaultFeedsList, storedFeedList...), nil
+// ListAll returns every Feed stored for the given user
+func (store FeedListStore) ListAll(userID string) ([]Feed, error) {
+	return store.listStored(userID)
 }
 
-func (store FeedListStore) listStored() ([]Feed, error) {
+func (store FeedListStore) listStored(userID string) ([]Feed, error) {
 	rawFeedList := []byte{}
 	err := store.db.View(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket([]byte(feedListBucket))
@@ -121,7 +135,7 @@ func (store FeedListStore) listStored() ([]Feed, error) {
 			log.Printf("Error: Bucket `" + feedListBucket + "` is unconfigured")
 			return ErrorUnconfiguredBucket
 		}
-		rawFeedList = bucket.Get([]byte(allFeedsBucketKey))
+		rawFeedList = bucket.Get([]byte(userID))
 		return nil
 	})
 
@@ -143,17 +157,17 @@ func (store FeedListStore) listStored() ([]Feed, error) {
 	return feedList, nil
 }
 
-// Add inserts a new Feed into the list, it also ensures we don't add a feed
-// twice
+// Add inserts a new Feed into the given user's list, it also ensures we
+// don't add a feed twice
 //
 // Note: Because of the sequence in this func there is a race condition
 // where we could add the same item to the DB twice if two requests come in
 // simultaneously. I'm ignoring it as it is again the same solution as the
 // Cached Fetcher, it's also not usually an issue with conventional databases
 // as we could have some uniqueness constraint set up
-func (store FeedListStore) Add(feed Feed) (string, error) {
+func (store FeedListStore) Add(feed Feed, userID string) (string, error) {
 	feed.ID = uuid.NewString()
-	existingFeeds, err := store.listStored()
+	existingFeeds, err := store.listStored(userID)
 	if err != nil {
 		return "", err
 	}
@@ -165,15 +179,6 @@ func (store FeedListStore) Add(feed Feed) (string, error) {
 		}
 	}
 
-	// Note: this wouldn't be needed in the final version as everything would
-	// be DB driven so we'd only range over the actual stored Feeds
-	for _, existingFeed := range defaultFeedsList {
-		// Don't add an existing feed to the DB
-		if existingFeed.URL == feed.URL {
-			return existingFeed.ID, nil
-		}
-	}
-
 	rawFeed, err := json.Marshal(append(existingFeeds, feed))
 	if err != nil {
 		log.Printf("Error: Failed to marshal feed %v", feed)
@@ -185,7 +190,7 @@ func (store FeedListStore) Add(feed Feed) (string, error) {
 			log.Printf("Error: Unconfigured bucket")
 			return ErrorUnconfiguredBucket
 		}
-		err := bucket.Put([]byte(allFeedsBucketKey), rawFeed)
+		err := bucket.Put([]byte(userID), rawFeed)
 		return err
 	})
 
@@ -196,9 +201,10 @@ func (store FeedListStore) Add(feed Feed) (string, error) {
 	return feed.ID, nil
 }
 
-// GetByID returns one stored feed by the matching ID field
-func (store FeedListStore) GetByID(ID string) (Feed, error) {
-	feeds, err := store.ListAll()
+// GetByID returns one stored feed by the matching ID field, scoped to the
+// given user
+func (store FeedListStore) GetByID(ID string, userID string) (Feed, error) {
+	feeds, err := store.ListAll(userID)
 	if err != nil {
 		return Feed{}, err
 	}
@@ -213,8 +219,59 @@ func (store FeedListStore) GetByID(ID string) (Feed, error) {
 	return Feed{}, ErrorFeedNotFound
 }
 
-func (store FeedListStore) init() error {
+// Update replaces a stored Feed, matched by ID, for the given user. It
+// exists so a refresh can persist the conditional-fetch headers and the
+// effective post-redirect URL without going through Add's
+// don't-add-it-twice logic.
+func (store FeedListStore) Update(feed Feed, userID string) error {
+	existingFeeds, err := store.listStored(userID)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i, existingFeed := range existingFeeds {
+		if existingFeed.ID == feed.ID {
+			existingFeeds[i] = feed
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ErrorFeedNotFound
+	}
+
+	rawFeeds, err := json.Marshal(existingFeeds)
+	if err != nil {
+		log.Printf("Error: Failed to marshal feed %v", feed)
+		return err
+	}
+
 	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(feedListBucket))
+		if bucket == nil {
+			log.Printf("Error: Unconfigured bucket")
+			return ErrorUnconfiguredBucket
+		}
+		return bucket.Put([]byte(userID), rawFeeds)
+	})
+}
+
+// SeedDefaultFeeds adds the demo feed list to a newly created user. It's
+// only called for the very first user, since multi-tenant data can't share
+// demo rows the way the old single-shared-list version did.
+func (store FeedListStore) SeedDefaultFeeds(userID string) error {
+	for _, feed := range defaultFeedsList {
+		if _, err := store.Add(feed, userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (store FeedListStore) init() error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists([]byte(feedListBucket))
 		if err != nil {
 			log.Printf("Error creating bucket: %s", err)
@@ -222,4 +279,9 @@ func (store FeedListStore) init() error {
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	return store.initCategories()
 }
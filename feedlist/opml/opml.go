@@ -0,0 +1,145 @@
+package opml
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"feed-reader/feedlist"
+)
+
+// ErrorNoFeedsFound is returned by Parse when an OPML document has no
+// outlines with an xmlUrl attribute
+var ErrorNoFeedsFound = errors.New("no feed outlines found in OPML document")
+
+// defaultImportCategory is the category title assigned to feed outlines that
+// aren't nested under a category outline of their own
+const defaultImportCategory = "Imported"
+
+// ImportedFeed is a feed outline parsed out of an OPML document, together
+// with the title of the category outline it was nested under - Parse only
+// knows outline titles, not CategoryIDs, so it's left to the caller to
+// resolve that title to a real Category
+type ImportedFeed struct {
+	Feed          feedlist.Feed
+	CategoryTitle string
+}
+
+type document struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    head     `xml:"head"`
+	Body    body     `xml:"body"`
+}
+
+type head struct {
+	Title string `xml:"title"`
+}
+
+type body struct {
+	Outlines []outline `xml:"outline"`
+}
+
+type outline struct {
+	Text     string    `xml:"text,attr"`
+	Title    string    `xml:"title,attr,omitempty"`
+	XMLURL   string    `xml:"xmlUrl,attr,omitempty"`
+	Outlines []outline `xml:"outline,omitempty"`
+}
+
+// Marshal renders feeds as an OPML 2.0 document, with one top-level outline
+// per category containing that category's feeds - the layout every other
+// RSS reader expects when importing a subscription list
+func Marshal(feeds []feedlist.Feed, categories []feedlist.Category) []byte {
+	categoryTitles := map[string]string{}
+	for _, category := range categories {
+		categoryTitles[category.ID] = category.Title
+	}
+
+	var categoryOrder []string
+	feedsByCategory := map[string][]outline{}
+	for _, feed := range feeds {
+		if _, seen := feedsByCategory[feed.CategoryID]; !seen {
+			categoryOrder = append(categoryOrder, feed.CategoryID)
+		}
+		feedsByCategory[feed.CategoryID] = append(feedsByCategory[feed.CategoryID], outline{
+			Text:   feed.Title,
+			Title:  feed.Title,
+			XMLURL: feed.URL,
+		})
+	}
+
+	doc := document{Version: "2.0", Head: head{Title: "Feed Subscriptions"}}
+	for _, categoryID := range categoryOrder {
+		title := categoryTitles[categoryID]
+		if title == "" {
+			title = categoryID
+		}
+		doc.Body.Outlines = append(doc.Body.Outlines, outline{
+			Text:     title,
+			Title:    title,
+			Outlines: feedsByCategory[categoryID],
+		})
+	}
+
+	// document never contains a type xml can't encode, so this can't fail
+	out, _ := xml.MarshalIndent(doc, "", "  ")
+
+	return append([]byte(xml.Header), out...)
+}
+
+// Parse reads an OPML document and returns every feed outline it finds
+// (those with an xmlUrl attribute), regardless of how deeply they're nested
+// under category outlines. Each feed is tagged with the title of the
+// outline it was grouped under - the mirror image of Marshal's one
+// top-level-outline-per-category layout - falling back to
+// defaultImportCategory for feeds with no enclosing category outline.
+func Parse(r io.Reader) ([]ImportedFeed, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := document{}
+	if err := xml.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	feeds := []ImportedFeed{}
+	var collect func(outlines []outline, categoryTitle string)
+	collect = func(outlines []outline, categoryTitle string) {
+		for _, o := range outlines {
+			label := o.Title
+			if label == "" {
+				label = o.Text
+			}
+
+			if o.XMLURL != "" {
+				ct := categoryTitle
+				if ct == "" {
+					ct = defaultImportCategory
+				}
+				feeds = append(feeds, ImportedFeed{
+					Feed:          feedlist.Feed{Title: label, URL: o.XMLURL},
+					CategoryTitle: ct,
+				})
+				collect(o.Outlines, categoryTitle)
+				continue
+			}
+
+			nested := label
+			if nested == "" {
+				nested = categoryTitle
+			}
+			collect(o.Outlines, nested)
+		}
+	}
+	collect(doc.Body.Outlines, "")
+
+	if len(feeds) == 0 {
+		return nil, ErrorNoFeedsFound
+	}
+
+	return feeds, nil
+}
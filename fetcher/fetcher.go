@@ -0,0 +1,100 @@
+package fetcher
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"feed-reader/feedlist"
+)
+
+// Fetcher knows how to go and fetch the latest articles for a Feed
+type Fetcher interface {
+	Fetch(feed feedlist.Feed, userID string) (Result, error)
+}
+
+// Result is whatever we got back from fetching a Feed
+type Result struct {
+	// NotModified is true when the upstream server returned a 304 for a
+	// conditional request, meaning there's nothing new to parse
+	NotModified bool
+	Articles    []Article
+}
+
+// Article is a single entry parsed out of a fetched feed
+type Article struct {
+	Title       string
+	Description string
+	URL         string
+	PublishedAt time.Time
+}
+
+// HttpFetcher is the default Fetcher, it goes over the network to get the
+// feed contents
+type HttpFetcher struct {
+	client *http.Client
+	store  feedlist.FeedListStore
+}
+
+// NewHttpFetcher returns a fully initialised HttpFetcher. It needs the
+// FeedListStore to write the ETag/Last-Modified headers and effective URL
+// back after a successful fetch.
+func NewHttpFetcher(store feedlist.FeedListStore) HttpFetcher {
+	return HttpFetcher{
+		client: &http.Client{Timeout: 10 * time.Second},
+		store:  store,
+	}
+}
+
+// Fetch downloads the given Feed's URL. The body is not parsed, so the
+// returned Result never carries any Articles. It sends the
+// conditional-request headers stored from the last successful fetch, and if
+// the server responds 304 Not Modified it stops there without touching the
+// store - mirroring Miniflux's Feed.WithClientResponse pattern, which saves
+// bandwidth on feeds that honor conditional GETs.
+func (f HttpFetcher) Fetch(feed feedlist.Feed, userID string) (Result, error) {
+	fetchURL := feed.URL
+	if feed.FeedURL != "" {
+		fetchURL = feed.FeedURL
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fetchURL, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	if feed.EtagHeader != "" {
+		req.Header.Set("If-None-Match", feed.EtagHeader)
+	}
+	if feed.LastModifiedHeader != "" {
+		req.Header.Set("If-Modified-Since", feed.LastModifiedHeader)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return Result{NotModified: true}, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return Result{}, fmt.Errorf("fetching %s: unexpected status %s", fetchURL, resp.Status)
+	}
+
+	// Note: the body isn't parsed at all, we just need something that
+	// round-trips a request so the API handlers have a real Fetcher to call
+	// into
+	feed.EtagHeader = resp.Header.Get("ETag")
+	feed.LastModifiedHeader = resp.Header.Get("Last-Modified")
+	if resp.Request != nil && resp.Request.URL != nil {
+		feed.FeedURL = resp.Request.URL.String()
+	}
+
+	if err := f.store.Update(feed, userID); err != nil {
+		return Result{}, err
+	}
+
+	return Result{}, nil
+}
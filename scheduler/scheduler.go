@@ -0,0 +1,113 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"feed-reader/feedlist"
+	"feed-reader/fetcher"
+	"feed-reader/userstore"
+)
+
+const (
+	// checkInterval is how often a healthy feed is refreshed
+	checkInterval = time.Hour
+	// maxBackoffHours caps how long a repeatedly failing feed waits between
+	// attempts, at one week
+	maxBackoffHours = 24 * 7
+	// pollInterval is how often the scheduler looks for feeds whose
+	// NextCheckAt has passed
+	pollInterval = time.Minute
+)
+
+// Scheduler periodically refreshes every stored feed across every user,
+// tracking ParsingErrorCount/LastCheckedAt/NextCheckAt so a feed that keeps
+// failing waits one more hour per consecutive failure (up to a week) instead
+// of being hammered every interval
+type Scheduler struct {
+	feedListStore feedlist.FeedListStore
+	userStore     userstore.UserStore
+	fetcher       fetcher.Fetcher
+}
+
+// New returns a fully initialised Scheduler
+func New(feedListStore feedlist.FeedListStore, userStore userstore.UserStore, feedFetcher fetcher.Fetcher) Scheduler {
+	return Scheduler{
+		feedListStore: feedListStore,
+		userStore:     userStore,
+		fetcher:       feedFetcher,
+	}
+}
+
+// Run starts the background refresh loop. It blocks, so callers should run
+// it in its own goroutine.
+func (s Scheduler) Run() {
+	for {
+		s.refreshDue()
+		time.Sleep(pollInterval)
+	}
+}
+
+func (s Scheduler) refreshDue() {
+	users, err := s.userStore.ListAll()
+	if err != nil {
+		log.Printf("Error: scheduler couldn't list users: %s", err)
+		return
+	}
+
+	now := time.Now()
+	for _, user := range users {
+		feeds, err := s.feedListStore.ListAll(user.ID)
+		if err != nil {
+			log.Printf("Error: scheduler couldn't list feeds for user %s: %s", user.ID, err)
+			continue
+		}
+
+		for _, feed := range feeds {
+			if feed.Disabled || feed.NextCheckAt.After(now) {
+				continue
+			}
+			if err := s.RefreshFeed(feed, user.ID); err != nil {
+				log.Printf("Error: scheduler failed to refresh feed %s: %s", feed.ID, err)
+			}
+		}
+	}
+}
+
+// RefreshFeed fetches a single feed and persists its refresh health,
+// following the backoff rule `v := errors + 1; if v > 24*7 { v = 24*7 };
+// NextCheckAt = now + v*hour` on failure, or resetting to a one hour
+// interval on success. It's used by the background loop and by the
+// POST /api/feeds/:id/refresh handler to force an immediate check.
+func (s Scheduler) RefreshFeed(feed feedlist.Feed, userID string) error {
+	_, fetchErr := s.fetcher.Fetch(feed, userID)
+
+	// Fetch already persisted the conditional-fetch headers and effective
+	// URL on a 200, so re-read the feed to layer the health fields on top
+	// of that rather than clobbering it with our stale copy
+	updated, err := s.feedListStore.GetByID(feed.ID, userID)
+	if err != nil {
+		return err
+	}
+
+	var interval time.Duration
+	if fetchErr != nil {
+		updated.ParsingErrorCount++
+		backoffHours := updated.ParsingErrorCount
+		if backoffHours > maxBackoffHours {
+			backoffHours = maxBackoffHours
+		}
+		interval = time.Duration(backoffHours) * time.Hour
+	} else {
+		// Any fetch that didn't error counts as healthy, 304 Not Modified
+		// included - there's no deeper parsing signal in this codebase to
+		// distinguish "nothing new" from "nothing wrong"
+		updated.ParsingErrorCount = 0
+		interval = checkInterval
+	}
+
+	updated.LastCheckedAt = time.Now()
+	updated.NextCheckAt = updated.LastCheckedAt.Add(interval)
+
+	return s.feedListStore.Update(updated, userID)
+}
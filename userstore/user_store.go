@@ -0,0 +1,204 @@
+package userstore
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/boltdb/bolt"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	userBucket  = "users"
+	allUsersKey = "all"
+)
+
+var (
+	// ErrorInitializingDB occurs only on startup when we are trying to get the
+	// DB set up
+	ErrorInitializingDB = errors.New("Error Initializing DB")
+	// ErrorUnconfiguredBucket occurs when there is a mismatch between the
+	// bucket we are using to read and what exists in the DB
+	ErrorUnconfiguredBucket = errors.New("Error Unconfigured Bucket")
+	// ErrorStoreUsersCorrupted occurs if somehow an invalid JSON blob is
+	// stored in the db
+	ErrorStoreUsersCorrupted = errors.New("Corrupted stored user list")
+	// ErrorUsernameTaken occurs when trying to create a user with a
+	// username that already exists
+	ErrorUsernameTaken = errors.New("Username already taken")
+	// ErrorInvalidCredentials occurs when a username/password or token
+	// doesn't match a stored user
+	ErrorInvalidCredentials = errors.New("Invalid credentials")
+)
+
+// User is an account that owns its own feed list
+type User struct {
+	ID           string
+	Username     string
+	PasswordHash string
+	APIToken     string
+}
+
+// UserStore is where accounts are kept
+type UserStore struct {
+	db *bolt.DB
+}
+
+// NewUserStore returns a fully initialised UserStore and should be the only
+// way used to get a hold of one
+func NewUserStore(db *bolt.DB) (UserStore, error) {
+	store := UserStore{db: db}
+	if err := store.init(); err != nil {
+		return UserStore{}, err
+	}
+
+	return store, nil
+}
+
+// Create registers a new User with a bcrypt-hashed password and a freshly
+// issued API token. Returns ErrorUsernameTaken if the username is already in
+// use.
+func (store UserStore) Create(username string, password string) (User, error) {
+	users, err := store.listStored()
+	if err != nil {
+		return User{}, err
+	}
+
+	for _, existingUser := range users {
+		if existingUser.Username == username {
+			return User{}, ErrorUsernameTaken
+		}
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return User{}, err
+	}
+
+	user := User{
+		ID:           uuid.NewString(),
+		Username:     username,
+		PasswordHash: string(passwordHash),
+		APIToken:     uuid.NewString(),
+	}
+
+	if err := store.persist(append(users, user)); err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// Authenticate checks a username/password pair against the stored bcrypt
+// hash, as used by HTTP Basic auth
+func (store UserStore) Authenticate(username string, password string) (User, error) {
+	users, err := store.listStored()
+	if err != nil {
+		return User{}, err
+	}
+
+	for _, user := range users {
+		if user.Username != username {
+			continue
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+			return User{}, ErrorInvalidCredentials
+		}
+		return user, nil
+	}
+
+	return User{}, ErrorInvalidCredentials
+}
+
+// GetByToken looks up a User by their issued APIToken
+func (store UserStore) GetByToken(token string) (User, error) {
+	users, err := store.listStored()
+	if err != nil {
+		return User{}, err
+	}
+
+	for _, user := range users {
+		if user.APIToken == token {
+			return user, nil
+		}
+	}
+
+	return User{}, ErrorInvalidCredentials
+}
+
+// ListAll returns every stored User. Used by the scheduler to walk every
+// account's feeds, since feeds are keyed per user.
+func (store UserStore) ListAll() ([]User, error) {
+	return store.listStored()
+}
+
+// Count returns how many users currently exist. Used to decide whether a
+// freshly created user is the first one, and should therefore get the demo
+// feed list seeded into their account.
+func (store UserStore) Count() (int, error) {
+	users, err := store.listStored()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(users), nil
+}
+
+func (store UserStore) listStored() ([]User, error) {
+	rawUsers := []byte{}
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(userBucket))
+		if bucket == nil {
+			log.Printf("Error: Bucket `" + userBucket + "` is unconfigured")
+			return ErrorUnconfiguredBucket
+		}
+		rawUsers = bucket.Get([]byte(allUsersKey))
+		return nil
+	})
+
+	if err != nil {
+		return []User{}, err
+	}
+
+	if len(rawUsers) == 0 {
+		return []User{}, nil
+	}
+
+	users := []User{}
+	if err := json.Unmarshal(rawUsers, &users); err != nil {
+		log.Printf("Error: can't unmarshal users %v", rawUsers)
+		return []User{}, ErrorStoreUsersCorrupted
+	}
+
+	return users, nil
+}
+
+func (store UserStore) persist(users []User) error {
+	rawUsers, err := json.Marshal(users)
+	if err != nil {
+		log.Printf("Error: Failed to marshal users %v", users)
+		return err
+	}
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(userBucket))
+		if bucket == nil {
+			log.Printf("Error: Unconfigured bucket")
+			return ErrorUnconfiguredBucket
+		}
+		return bucket.Put([]byte(allUsersKey), rawUsers)
+	})
+}
+
+func (store UserStore) init() error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(userBucket))
+		if err != nil {
+			log.Printf("Error creating bucket: %s", err)
+			return ErrorInitializingDB
+		}
+		return nil
+	})
+}